@@ -0,0 +1,268 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// Copyright (c) 2023, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the LICENSE.md file
+// distributed with the sources of this project regarding your rights to use or distribute this
+// software.
+
+package integrity
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+)
+
+// dsseEnvelope is the JSON encoding of a Dead Simple Signing Envelope, as
+// consumed by the sigstore/cosign ecosystem.
+type dsseEnvelope struct {
+	PayloadType string          `json:"payloadType"`
+	Payload     string          `json:"payload"`
+	Signatures  []dsseSignature `json:"signatures"`
+}
+
+type dsseSignature struct {
+	KeyID string `json:"keyid,omitempty"`
+	Sig   string `json:"sig"`
+}
+
+var errDSSESignatureMismatch = errors.New("DSSE signature verification failed")
+
+// dsseSigner abstracts over the mechanics needed to produce a signature over
+// an envelope payload, so the DSSE path can be plugged into the same call
+// sites as the OpenPGP clearsign path (see signAndEncodeJSON).
+type dsseSigner interface {
+	// keyID identifies the signing key, and is recorded alongside the
+	// signature so a verifier can select the matching public key.
+	keyID() string
+
+	// signMessage signs message and returns the raw signature bytes.
+	signMessage(message []byte) ([]byte, error)
+}
+
+// NewDSSEECDSASigner returns a dsseSigner that signs with key, an ECDSA
+// private key, identifying itself to verifiers with keyID.
+func NewDSSEECDSASigner(keyID string, key *ecdsa.PrivateKey) dsseSigner { //nolint:revive
+	return ecdsaSigner{id: keyID, key: key}
+}
+
+// NewDSSEEd25519Signer returns a dsseSigner that signs with key, an Ed25519
+// private key, identifying itself to verifiers with keyID.
+func NewDSSEEd25519Signer(keyID string, key ed25519.PrivateKey) dsseSigner { //nolint:revive
+	return ed25519Signer{id: keyID, key: key}
+}
+
+type ecdsaSigner struct {
+	id  string
+	key *ecdsa.PrivateKey
+}
+
+func (s ecdsaSigner) keyID() string { return s.id }
+
+func (s ecdsaSigner) signMessage(message []byte) ([]byte, error) {
+	h := sha256.Sum256(message)
+	return ecdsa.SignASN1(rand.Reader, s.key, h[:])
+}
+
+type ed25519Signer struct {
+	id  string
+	key ed25519.PrivateKey
+}
+
+func (s ed25519Signer) keyID() string { return s.id }
+
+func (s ed25519Signer) signMessage(message []byte) ([]byte, error) {
+	return ed25519.Sign(s.key, message), nil
+}
+
+// preAuthEncode implements the DSSE Pre-Authentication Encoding (PAE) used
+// to bind the payload type into the signed bytes, preventing a signature
+// produced for one payload type from being replayed as another.
+func preAuthEncode(payloadType string, payload []byte) []byte {
+	return []byte(fmt.Sprintf("DSSEv1 %d %s %d %s", len(payloadType), payloadType, len(payload), payload))
+}
+
+// signAndEncodeDSSE signs payload as payloadType with signer, and returns the
+// encoded DSSE envelope. It is the DSSE counterpart to signAndEncodeJSON,
+// and is stored in the same signature descriptor slot in the SIF.
+func signAndEncodeDSSE(payloadType string, payload []byte, signer dsseSigner) ([]byte, error) {
+	sig, err := signer.signMessage(preAuthEncode(payloadType, payload))
+	if err != nil {
+		return nil, fmt.Errorf("signing DSSE payload: %w", err)
+	}
+
+	env := dsseEnvelope{
+		PayloadType: payloadType,
+		Payload:     base64.StdEncoding.EncodeToString(payload),
+		Signatures: []dsseSignature{
+			{KeyID: signer.keyID(), Sig: base64.StdEncoding.EncodeToString(sig)},
+		},
+	}
+
+	b, err := json.Marshal(env)
+	if err != nil {
+		return nil, fmt.Errorf("encoding DSSE envelope: %w", err)
+	}
+
+	return b, nil
+}
+
+// SignDSSE signs payload as payloadType with signer and returns the encoded
+// DSSE envelope, for storage in the same signature descriptor slot in the
+// SIF as an OpenPGP clearsigned entry produced by signAndEncodeJSON.
+func SignDSSE(payloadType string, payload []byte, signer dsseSigner) ([]byte, error) { //nolint:revive
+	return signAndEncodeDSSE(payloadType, payload, signer)
+}
+
+// VerifyDSSE verifies a DSSE envelope against pub and returns the decoded
+// payload. Callers should check IsDSSEEnvelope first to decide whether a
+// given signature descriptor holds a DSSE envelope or OpenPGP-clearsigned
+// JSON, and dispatch to VerifyDSSE or verifyAndDecodeJSON accordingly.
+func VerifyDSSE(envelope []byte, pub crypto.PublicKey) ([]byte, error) {
+	return verifyAndDecodeDSSE(envelope, pub)
+}
+
+// IsDSSEEnvelope reports whether b looks like an encoded DSSE envelope,
+// rather than the OpenPGP-clearsigned JSON produced by signAndEncodeJSON.
+// Verification call sites use this to dispatch on payload/envelope shape.
+func IsDSSEEnvelope(b []byte) bool {
+	var env dsseEnvelope
+	if err := json.Unmarshal(b, &env); err != nil {
+		return false
+	}
+	return env.PayloadType != "" && env.Payload != "" && len(env.Signatures) > 0
+}
+
+// verifyAndDecodeDSSE verifies b as a DSSE envelope against pub, and returns
+// the decoded payload. It is the DSSE counterpart to verifyAndDecodeJSON.
+func verifyAndDecodeDSSE(b []byte, pub crypto.PublicKey) ([]byte, error) {
+	var env dsseEnvelope
+	if err := json.Unmarshal(b, &env); err != nil {
+		return nil, fmt.Errorf("decoding DSSE envelope: %w", err)
+	}
+
+	payload, err := base64.StdEncoding.DecodeString(env.Payload)
+	if err != nil {
+		return nil, fmt.Errorf("decoding DSSE payload: %w", err)
+	}
+
+	if len(env.Signatures) == 0 {
+		return nil, errors.New("DSSE envelope has no signatures")
+	}
+
+	message := preAuthEncode(env.PayloadType, payload)
+
+	var verifyErr error
+	for _, sig := range env.Signatures {
+		raw, err := base64.StdEncoding.DecodeString(sig.Sig)
+		if err != nil {
+			verifyErr = err
+			continue
+		}
+
+		if err := verifyDSSESignature(message, raw, pub); err != nil {
+			verifyErr = err
+			continue
+		}
+
+		return payload, nil
+	}
+
+	return nil, fmt.Errorf("%w: %v", errDSSESignatureMismatch, verifyErr)
+}
+
+// verifyDSSESignature verifies sig over message using pub, dispatching on
+// the concrete public key type.
+func verifyDSSESignature(message, sig []byte, pub crypto.PublicKey) error {
+	switch key := pub.(type) {
+	case *ecdsa.PublicKey:
+		h := sha256.Sum256(message)
+		if !ecdsa.VerifyASN1(key, h[:], sig) {
+			return errDSSESignatureMismatch
+		}
+		return nil
+	case ed25519.PublicKey:
+		if !ed25519.Verify(key, message, sig) {
+			return errDSSESignatureMismatch
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported DSSE public key type %T", pub)
+	}
+}
+
+// VerifyDSSEKeyless verifies a DSSE envelope that was signed with a
+// short-lived, OIDC-issued certificate (for example one minted by Fulcio),
+// rather than a long-lived key. certPEM is the signing certificate, as
+// embedded in or shipped alongside the envelope, followed by any
+// intermediate certificates needed to chain it to roots, the pool of
+// trusted certificate authorities used to validate that chain.
+//
+// On success, it returns the verified certificate and the decoded payload,
+// so callers can inspect the certificate's OIDC identity (for example its
+// SAN or issuer extension) before trusting the payload.
+func VerifyDSSEKeyless(envelope, certPEM []byte, roots *x509.CertPool) (*x509.Certificate, []byte, error) {
+	cert, intermediates, err := parseCertChain(certPEM)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if _, err := cert.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+	}); err != nil {
+		return nil, nil, fmt.Errorf("verifying certificate chain: %w", err)
+	}
+
+	payload, err := verifyAndDecodeDSSE(envelope, cert.PublicKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return cert, payload, nil
+}
+
+// parseCertChain decodes certPEM as a leaf certificate followed by zero or
+// more intermediate certificates (as Fulcio typically returns them), and
+// returns the leaf along with a pool containing the intermediates.
+func parseCertChain(certPEM []byte) (*x509.Certificate, *x509.CertPool, error) {
+	var leaf *x509.Certificate
+	intermediates := x509.NewCertPool()
+
+	rest := certPEM
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, nil, fmt.Errorf("parsing signing certificate: %w", err)
+		}
+
+		if leaf == nil {
+			leaf = cert
+		} else {
+			intermediates.AddCert(cert)
+		}
+	}
+
+	if leaf == nil {
+		return nil, nil, errors.New("failed to decode certificate PEM")
+	}
+
+	return leaf, intermediates, nil
+}
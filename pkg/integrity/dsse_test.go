@@ -0,0 +1,232 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// Copyright (c) 2023, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the LICENSE.md file
+// distributed with the sources of this project regarding your rights to use or distribute this
+// software.
+
+package integrity
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func TestSignAndVerifyAndDecodeDSSE(t *testing.T) {
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ed25519Pub, ed25519Priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		signer dsseSigner
+		pub    interface{}
+	}{
+		{name: "ECDSA", signer: NewDSSEECDSASigner("ecdsa-key", ecdsaKey), pub: &ecdsaKey.PublicKey},
+		{name: "Ed25519", signer: NewDSSEEd25519Signer("ed25519-key", ed25519Priv), pub: ed25519Pub},
+	}
+
+	payload := []byte(`{"One":1,"Two":2}`)
+	payloadType := "application/vnd.sif.signature+json"
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			env, err := signAndEncodeDSSE(payloadType, payload, tt.signer)
+			if err != nil {
+				t.Fatalf("failed to sign: %v", err)
+			}
+
+			if !IsDSSEEnvelope(env) {
+				t.Fatal("expected encoded envelope to be recognized as DSSE")
+			}
+
+			got, err := verifyAndDecodeDSSE(env, tt.pub)
+			if err != nil {
+				t.Fatalf("failed to verify: %v", err)
+			}
+
+			if !bytes.Equal(got, payload) {
+				t.Errorf("got payload %s, want %s", got, payload)
+			}
+		})
+	}
+}
+
+func TestVerifyAndDecodeDSSECorrupted(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	env, err := signAndEncodeDSSE("application/vnd.sif.signature+json", []byte(`{"One":1}`), NewDSSEECDSASigner("k", key))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The payload is base64-encoded inside the envelope, so corrupt it in
+	// its encoded form.
+	corrupted := bytes.Replace(env,
+		[]byte(base64.StdEncoding.EncodeToString([]byte(`{"One":1}`))),
+		[]byte(base64.StdEncoding.EncodeToString([]byte(`{"One":2}`))), 1)
+
+	if _, err := verifyAndDecodeDSSE(corrupted, &key.PublicKey); !errors.Is(err, errDSSESignatureMismatch) {
+		t.Fatalf("got error %v, want %v", err, errDSSESignatureMismatch)
+	}
+}
+
+func TestSignDSSEAndVerifyDSSE(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payload := []byte(`{"One":1,"Two":2}`)
+
+	env, err := SignDSSE("application/vnd.sif.signature+json", payload, NewDSSEECDSASigner("k", key))
+	if err != nil {
+		t.Fatalf("failed to sign: %v", err)
+	}
+
+	got, err := VerifyDSSE(env, &key.PublicKey)
+	if err != nil {
+		t.Fatalf("failed to verify: %v", err)
+	}
+
+	if !bytes.Equal(got, payload) {
+		t.Errorf("got payload %s, want %s", got, payload)
+	}
+}
+
+// issueCert signs a certificate for tmpl with key, using parent/parentKey as
+// the issuer (or itself, for a self-signed root), and returns both the
+// certificate and its PEM encoding.
+func issueCert(t *testing.T, tmpl, parent *x509.Certificate, pub interface{}, parentKey *ecdsa.PrivateKey) (*x509.Certificate, []byte) {
+	t.Helper()
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, pub, parentKey)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("failed to parse certificate: %v", err)
+	}
+
+	return cert, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func TestVerifyDSSEKeylessWithIntermediate(t *testing.T) {
+	now := time.Now()
+
+	rootKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rootTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "root"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	root, _ := issueCert(t, rootTmpl, rootTmpl, &rootKey.PublicKey, rootKey)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(root)
+
+	intermediateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	intermediateTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(2),
+		Subject:               pkix.Name{CommonName: "intermediate"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	intermediate, intermediatePEM := issueCert(t, intermediateTmpl, root, &intermediateKey.PublicKey, rootKey)
+
+	leafKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leafTmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(3),
+		Subject:      pkix.Name{CommonName: "leaf"},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+	}
+	_, leafPEM := issueCert(t, leafTmpl, intermediate, &leafKey.PublicKey, intermediateKey)
+
+	payload := []byte(`{"One":1,"Two":2}`)
+	env, err := SignDSSE("application/vnd.sif.signature+json", payload, NewDSSEECDSASigner("leaf", leafKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// certPEM carries the leaf followed by the intermediate, as Fulcio
+	// typically returns the chain, so VerifyDSSEKeyless must build an
+	// Intermediates pool from it rather than only trusting a leaf that
+	// chains directly to a root.
+	certPEM := append(append([]byte{}, leafPEM...), intermediatePEM...)
+
+	cert, got, err := VerifyDSSEKeyless(env, certPEM, roots)
+	if err != nil {
+		t.Fatalf("failed to verify: %v", err)
+	}
+
+	if got, want := cert.Subject.CommonName, "leaf"; got != want {
+		t.Errorf("got common name %v, want %v", got, want)
+	}
+	if !bytes.Equal(got, payload) {
+		t.Errorf("got payload %s, want %s", got, payload)
+	}
+}
+
+func TestIsDSSEEnvelope(t *testing.T) {
+	tests := []struct {
+		name string
+		b    []byte
+		want bool
+	}{
+		{name: "NotJSON", b: []byte("not json"), want: false},
+		{name: "ClearsignedJSON", b: []byte(`{"data":"...","signature":"..."}`), want: false},
+		{name: "DSSE", b: []byte(`{"payloadType":"t","payload":"cGF5bG9hZA==","signatures":[{"sig":"c2lnbmF0dXJl"}]}`), want: true},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsDSSEEnvelope(tt.b); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
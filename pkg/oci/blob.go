@@ -0,0 +1,19 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// Copyright (c) 2023, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package oci
+
+import "bytes"
+
+// newBlobReader returns a ReaderAt-capable reader over an in-memory blob,
+// such as a synthesized config, so it can be handled the same way as the
+// layer blob that reads directly from the underlying FileImage.
+func newBlobReader(b []byte) *bytes.Reader {
+	return bytes.NewReader(b)
+}
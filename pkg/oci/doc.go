@@ -0,0 +1,17 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// Copyright (c) 2023, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// Package oci exposes a loaded SIF container as an OCI image source.
+//
+// A Source wraps a sif.FileImage, locates its primary root filesystem
+// partition, and synthesizes an OCI manifest, config, and single-layer blob
+// on top of it. This lets image tooling built against the OCI distribution
+// spec (for example skopeo or containers/image) read a SIF file directly,
+// without shelling out to Singularity or Apptainer.
+package oci
@@ -0,0 +1,209 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// Copyright (c) 2023, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package oci
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	digest "github.com/opencontainers/go-digest"
+	ispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/sylabs/sif/pkg/sif"
+)
+
+// Source adapts a loaded SIF container so it can be read as an OCI image:
+// a single-layer manifest whose layer digest is the SHA-256 of the primary
+// root filesystem partition, and a config synthesized from that partition's
+// metadata.
+type Source struct {
+	fimg  *sif.FileImage
+	descr *sif.Descriptor
+
+	entrypoint []string
+	env        []string
+
+	layerDigest digest.Digest
+	layerSize   int64
+}
+
+// SourceOption configures a Source constructed by NewSource.
+type SourceOption func(*Source)
+
+// OptEntrypoint sets the entrypoint recorded in the synthesized OCI config.
+func OptEntrypoint(entrypoint ...string) SourceOption {
+	return func(s *Source) {
+		s.entrypoint = entrypoint
+	}
+}
+
+// OptEnv sets additional "KEY=value" environment variables recorded in the
+// synthesized OCI config.
+func OptEnv(env ...string) SourceOption {
+	return func(s *Source) {
+		s.env = env
+	}
+}
+
+// NewSource returns a Source that exposes fimg's primary root filesystem
+// partition as a single-layer OCI image. fimg must remain open and valid
+// for the lifetime of the returned Source.
+func NewSource(fimg *sif.FileImage, opts ...SourceOption) (*Source, error) {
+	descr, _, err := fimg.GetPartPrimSys()
+	if err != nil {
+		return nil, fmt.Errorf("locating primary system partition: %w", err)
+	}
+
+	fstype, err := descr.GetFsType()
+	if err != nil {
+		return nil, fmt.Errorf("determining partition filesystem: %w", err)
+	}
+	if fstype != sif.FsSquash && fstype != sif.FsExt3 {
+		return nil, fmt.Errorf("unsupported root filesystem type %v for OCI export", fstype)
+	}
+
+	s := &Source{fimg: fimg, descr: descr}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	if err := s.hashLayer(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// hashLayer computes the SHA-256 digest of the partition bytes without
+// buffering the whole partition in memory.
+func (s *Source) hashLayer() error {
+	sr := io.NewSectionReader(s.fimg.Reader, s.descr.Fileoff, s.descr.Filelen)
+
+	h := sha256.New()
+	n, err := io.Copy(h, sr)
+	if err != nil {
+		return fmt.Errorf("hashing partition data: %w", err)
+	}
+
+	s.layerDigest = digest.NewDigestFromEncoded(digest.SHA256, hex.EncodeToString(h.Sum(nil)))
+	s.layerSize = n
+
+	return nil
+}
+
+// LayerDigest returns the digest of the single layer backed by the
+// partition's raw bytes.
+func (s *Source) LayerDigest() digest.Digest {
+	return s.layerDigest
+}
+
+// GetBlob returns a reader over the blob identified by d, along with its
+// size. It supports the layer blob and the synthesized config blob.
+func (s *Source) GetBlob(d digest.Digest) (io.ReadCloser, int64, error) {
+	if d == s.layerDigest {
+		sr := io.NewSectionReader(s.fimg.Reader, s.descr.Fileoff, s.descr.Filelen)
+		return io.NopCloser(sr), s.layerSize, nil
+	}
+
+	config, err := s.config()
+	if err != nil {
+		return nil, 0, err
+	}
+	if cd := digest.FromBytes(config); cd == d {
+		return io.NopCloser(newBlobReader(config)), int64(len(config)), nil
+	}
+
+	return nil, 0, fmt.Errorf("unknown blob digest %v", d)
+}
+
+// config synthesizes an OCI image config from the partition's metadata and
+// any entrypoint/env supplied via NewSource's options.
+func (s *Source) config() ([]byte, error) {
+	// Derive the arch from the partition descriptor, not the global header:
+	// on a multi-architecture "fat" SIF, Header.Arch is the HdrArchMulti
+	// sentinel rather than a real architecture.
+	sifArch, err := s.descr.GetArch()
+	if err != nil {
+		return nil, fmt.Errorf("determining partition arch: %w", err)
+	}
+
+	arch, err := sif.GetGoArch(sifArch)
+	if err != nil {
+		return nil, fmt.Errorf("mapping SIF arch: %w", err)
+	}
+
+	cfg := ispec.Image{
+		Created: timePtr(time.Unix(s.descr.Mtime, 0).UTC()),
+		Platform: ispec.Platform{
+			Architecture: arch,
+			OS:           "linux",
+		},
+		Config: ispec.ImageConfig{
+			Entrypoint: s.entrypoint,
+			Env:        s.env,
+		},
+		RootFS: ispec.RootFS{
+			Type:    "layers",
+			DiffIDs: []digest.Digest{s.layerDigest},
+		},
+	}
+
+	return json.Marshal(cfg)
+}
+
+// Manifest returns the encoded OCI manifest for the image, along with its
+// digest.
+func (s *Source) Manifest() ([]byte, digest.Digest, error) {
+	config, err := s.config()
+	if err != nil {
+		return nil, "", err
+	}
+
+	m := ispec.Manifest{
+		Versioned: ispec.Versioned(struct{ SchemaVersion int }{SchemaVersion: 2}),
+		MediaType: ispec.MediaTypeImageManifest,
+		Config: ispec.Descriptor{
+			MediaType: ispec.MediaTypeImageConfig,
+			Digest:    digest.FromBytes(config),
+			Size:      int64(len(config)),
+		},
+		Layers: []ispec.Descriptor{
+			{
+				MediaType: layerMediaType(s.descr),
+				Digest:    s.layerDigest,
+				Size:      s.layerSize,
+			},
+		},
+	}
+
+	b, err := json.Marshal(m)
+	if err != nil {
+		return nil, "", fmt.Errorf("encoding manifest: %w", err)
+	}
+
+	return b, digest.FromBytes(b), nil
+}
+
+// layerMediaType picks the OCI layer media type matching the partition's
+// filesystem, so consumers know how to unpack it.
+func layerMediaType(descr *sif.Descriptor) string {
+	if fstype, err := descr.GetFsType(); err == nil && fstype == sif.FsExt3 {
+		return "application/vnd.sylabs.sif.layer.v1.ext3"
+	}
+	return "application/vnd.sylabs.sif.layer.v1.squashfs"
+}
+
+func timePtr(t time.Time) *time.Time {
+	return &t
+}
@@ -0,0 +1,151 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// Copyright (c) 2023, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package oci
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"runtime"
+	"testing"
+
+	ispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/sylabs/sif/pkg/sif"
+)
+
+// primarySystemFileImage builds a FileImage carrying a single primary
+// system partition over data, tagged for goarch, for use in tests that
+// don't need a real file on disk behind it.
+func primarySystemFileImage(t *testing.T, data []byte, goarch string) sif.FileImage {
+	t.Helper()
+
+	var part struct {
+		Fstype   sif.Fstype
+		Parttype sif.Parttype
+		Arch     [sif.HdrArchLen]byte
+	}
+	part.Fstype = sif.FsSquash
+	part.Parttype = sif.PartPrimSys
+	copy(part.Arch[:], sif.GetSIFArch(goarch))
+
+	extra := bytes.Buffer{}
+	if err := binary.Write(&extra, binary.LittleEndian, part); err != nil {
+		t.Fatalf("encoding partition extra data: %v", err)
+	}
+
+	var descr sif.Descriptor
+	descr.Used = true
+	descr.Datatype = sif.DataPartition
+	descr.Fileoff = 0
+	descr.Filelen = int64(len(data))
+	copy(descr.Extra[:], extra.Bytes())
+
+	return sif.FileImage{
+		DescrArr: []sif.Descriptor{descr},
+		Reader:   bytes.NewReader(data),
+	}
+}
+
+func TestNewSourceConfigArchFromPartition(t *testing.T) {
+	data := []byte("squashfs-partition-bytes")
+	fimg := primarySystemFileImage(t, data, runtime.GOARCH)
+
+	// The global header is deliberately left at the HdrArchMulti sentinel,
+	// as it would be on a multi-architecture "fat" SIF: config() must
+	// derive the arch from the partition descriptor, not this field.
+	copy(fimg.Header.Arch[:], sif.HdrArchMulti)
+
+	s, err := NewSource(&fimg)
+	if err != nil {
+		t.Fatalf("NewSource: %v", err)
+	}
+
+	wantDigest := sha256.Sum256(data)
+	if got, want := s.LayerDigest().Encoded(), hex.EncodeToString(wantDigest[:]); got != want {
+		t.Errorf("got layer digest %v, want %v", got, want)
+	}
+
+	configBlob, err := s.config()
+	if err != nil {
+		t.Fatalf("config: %v", err)
+	}
+
+	var cfg ispec.Image
+	if err := json.Unmarshal(configBlob, &cfg); err != nil {
+		t.Fatalf("unmarshaling config: %v", err)
+	}
+
+	if got, want := cfg.Platform.Architecture, runtime.GOARCH; got != want {
+		t.Errorf("got arch %v, want %v", got, want)
+	}
+}
+
+func TestSourceGetBlob(t *testing.T) {
+	data := []byte("squashfs-partition-bytes")
+	fimg := primarySystemFileImage(t, data, runtime.GOARCH)
+
+	s, err := NewSource(&fimg)
+	if err != nil {
+		t.Fatalf("NewSource: %v", err)
+	}
+
+	rc, size, err := s.GetBlob(s.LayerDigest())
+	if err != nil {
+		t.Fatalf("GetBlob(layer): %v", err)
+	}
+	defer rc.Close()
+
+	got, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("got layer blob %q, want %q", got, data)
+	}
+	if int64(len(got)) != size {
+		t.Errorf("got size %d, want %d", size, len(got))
+	}
+
+	_, _, err = s.GetBlob("sha256:0000000000000000000000000000000000000000000000000000000000000000")
+	if err == nil {
+		t.Error("expected error for unknown blob digest, got nil")
+	}
+}
+
+func TestSourceManifest(t *testing.T) {
+	data := []byte("squashfs-partition-bytes")
+	fimg := primarySystemFileImage(t, data, runtime.GOARCH)
+
+	s, err := NewSource(&fimg, OptEntrypoint("/bin/sh"), OptEnv("FOO=bar"))
+	if err != nil {
+		t.Fatalf("NewSource: %v", err)
+	}
+
+	b, d, err := s.Manifest()
+	if err != nil {
+		t.Fatalf("Manifest: %v", err)
+	}
+
+	var m ispec.Manifest
+	if err := json.Unmarshal(b, &m); err != nil {
+		t.Fatalf("unmarshaling manifest: %v", err)
+	}
+
+	if got, want := m.Layers[0].Digest, s.LayerDigest(); got != want {
+		t.Errorf("got layer digest %v, want %v", got, want)
+	}
+	if d == "" {
+		t.Error("expected non-empty manifest digest")
+	}
+}
@@ -0,0 +1,174 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// Copyright (c) 2023, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+)
+
+// HdrArchMulti is a sentinel Header.Arch value indicating that a SIF file
+// is a multi-architecture "fat" image: it carries root filesystem
+// partitions for more than one architecture, each identified by its own
+// Descriptor's arch rather than by the global header.
+const HdrArchMulti = "99"
+
+// goArches lists the GOARCH values GetSIFArch knows how to encode, for use
+// by GetGoArch to invert the mapping.
+var goArches = []string{
+	"386", "amd64", "arm", "arm64", "ppc64", "ppc64le",
+	"mips", "mipsle", "mips64", "mips64le", "s390x",
+}
+
+// GetGoArch returns the GOARCH value corresponding to hdrArch, a SIF
+// Header.Arch encoding as produced by GetSIFArch. It is the inverse of
+// GetSIFArch, used to recover a Go-style arch name (for example to
+// populate an OCI platform string) from a partition or global header arch.
+func GetGoArch(hdrArch string) (string, error) {
+	for _, goarch := range goArches {
+		if GetSIFArch(goarch) == hdrArch {
+			return goarch, nil
+		}
+	}
+	return "", fmt.Errorf("SIF arch %v not supported", hdrArch)
+}
+
+// partition decodes descr's Extra field into a Partition, the same layout
+// GetFsType and GetPartType read Fstype and Parttype from.
+func (descr *Descriptor) partition() (Partition, error) {
+	var part Partition
+	if err := binary.Read(bytes.NewReader(descr.Extra[:]), binary.LittleEndian, &part); err != nil {
+		return part, fmt.Errorf("decoding partition extra data: %w", err)
+	}
+	return part, nil
+}
+
+// GetArch returns the architecture of the partition described by descr, in
+// the same encoding as Header.Arch, by decoding its partition extra data.
+func (descr *Descriptor) GetArch() (string, error) {
+	part, err := descr.partition()
+	if err != nil {
+		return "", err
+	}
+	return string(part.Arch[:HdrArchLen-1]), nil
+}
+
+// SelectPartition returns the descriptor and index of the system partition
+// built for goarch (a GOARCH value, such as "amd64" or "arm64") within a
+// multi-architecture "fat" SIF. Callers that only need the host's partition
+// typically pass runtime.GOARCH.
+func (fimg *FileImage) SelectPartition(goarch string) (*Descriptor, int, error) {
+	sifArch := GetSIFArch(goarch)
+	if sifArch == HdrArchUnknown {
+		return nil, -1, fmt.Errorf("GOARCH %v not supported", goarch)
+	}
+
+	for i := range fimg.DescrArr {
+		descr := &fimg.DescrArr[i]
+		if !descr.Used || descr.Datatype != DataPartition {
+			continue
+		}
+
+		ptype, err := descr.GetPartType()
+		if err != nil || (ptype != PartSystem && ptype != PartPrimSys) {
+			continue
+		}
+
+		arch, err := descr.GetArch()
+		if err != nil || arch != sifArch {
+			continue
+		}
+
+		return descr, i, nil
+	}
+
+	return nil, -1, fmt.Errorf("no system partition found for arch %s", goarch)
+}
+
+// ArchPartitions returns the index in fimg.DescrArr of every system partition
+// in fimg, keyed by architecture, for use by tooling that lists or edits
+// the partitions of a multi-architecture "fat" SIF.
+func (fimg *FileImage) ArchPartitions() (map[string]int, error) {
+	arches := make(map[string]int)
+
+	for i := range fimg.DescrArr {
+		descr := &fimg.DescrArr[i]
+		if !descr.Used || descr.Datatype != DataPartition {
+			continue
+		}
+
+		ptype, err := descr.GetPartType()
+		if err != nil || (ptype != PartSystem && ptype != PartPrimSys) {
+			continue
+		}
+
+		arch, err := descr.GetArch()
+		if err != nil {
+			return nil, fmt.Errorf("reading arch of partition %d: %w", descr.ID, err)
+		}
+
+		arches[arch] = i
+	}
+
+	return arches, nil
+}
+
+// AddPartition appends a new system partition read from fp as a root
+// filesystem for goarch, turning fimg into (or extending) a
+// multi-architecture "fat" SIF. Callers should follow up with
+// SetHeaderArch(HdrArchMulti) once more than one architecture is present.
+func (fimg *FileImage) AddPartition(fp *os.File, goarch string, fstype Fstype, parttype Parttype) error {
+	sifArch := GetSIFArch(goarch)
+	if sifArch == HdrArchUnknown {
+		return fmt.Errorf("GOARCH %v not supported", goarch)
+	}
+
+	var part Partition
+	part.Fstype = fstype
+	part.Parttype = parttype
+	copy(part.Arch[:], sifArch)
+
+	extra := bytes.Buffer{}
+	if err := binary.Write(&extra, binary.LittleEndian, part); err != nil {
+		return fmt.Errorf("encoding partition extra data: %w", err)
+	}
+
+	return fimg.AddObject(DescriptorInput{
+		Datatype: DataPartition,
+		Fname:    fmt.Sprintf("rootfs-%s", sifArch),
+		Fp:       fp,
+		Extra:    extra,
+	})
+}
+
+// SetHeaderArch overwrites fimg's global header architecture field and
+// writes the change through to the underlying file, via fimg's backend. It
+// is used to set the HdrArchMulti sentinel once a SIF carries partitions
+// for more than one architecture.
+func (fimg *FileImage) SetHeaderArch(arch string) error {
+	if fimg.backend == nil {
+		return fmt.Errorf("SetHeaderArch requires a FileImage backed by a file")
+	}
+
+	copy(fimg.Header.Arch[:], arch)
+
+	var buf bytes.Buffer
+	if err := binary.Write(&buf, binary.LittleEndian, fimg.Header); err != nil {
+		return fmt.Errorf("encoding global header: %w", err)
+	}
+
+	if _, err := fimg.backend.WriteAt(buf.Bytes(), 0); err != nil {
+		return fmt.Errorf("writing global header: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,81 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// Copyright (c) 2023, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"bytes"
+	"encoding/binary"
+	"runtime"
+	"testing"
+)
+
+// hostPartitionDescriptor builds a used system-partition Descriptor for
+// goarch, the same shape AddPartition produces, for use in tests that don't
+// need a real file behind the partition's data.
+func hostPartitionDescriptor(t *testing.T, goarch string) Descriptor {
+	t.Helper()
+
+	var part Partition
+	part.Fstype = FsSquash
+	part.Parttype = PartPrimSys
+	copy(part.Arch[:], GetSIFArch(goarch))
+
+	extra := bytes.Buffer{}
+	if err := binary.Write(&extra, binary.LittleEndian, part); err != nil {
+		t.Fatalf("encoding partition extra data: %v", err)
+	}
+
+	var d Descriptor
+	d.Used = true
+	d.Datatype = DataPartition
+	copy(d.Extra[:], extra.Bytes())
+
+	return d
+}
+
+func TestSelectPartition(t *testing.T) {
+	fimg := FileImage{DescrArr: []Descriptor{hostPartitionDescriptor(t, runtime.GOARCH)}}
+
+	descr, i, err := fimg.SelectPartition(runtime.GOARCH)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if i != 0 {
+		t.Errorf("got index %d, want 0", i)
+	}
+	if arch, err := descr.GetArch(); err != nil || arch != GetSIFArch(runtime.GOARCH) {
+		t.Errorf("got arch %v (err %v), want %v", arch, err, GetSIFArch(runtime.GOARCH))
+	}
+
+	if _, _, err := fimg.SelectPartition("bogusarch"); err == nil {
+		t.Error("expected error for unsupported GOARCH, got nil")
+	}
+}
+
+// TestIsValidSifMultiArchRequiresDescriptors guards against validating a
+// multi-arch "fat" SIF's header before its descriptor array has been
+// populated: SelectPartition has nothing to look at and always fails, even
+// when the container does carry a matching partition.
+func TestIsValidSifMultiArchRequiresDescriptors(t *testing.T) {
+	var fimg FileImage
+	copy(fimg.Header.Magic[:], HdrMagic)
+	copy(fimg.Header.Version[:], HdrVersion)
+	copy(fimg.Header.Arch[:], HdrArchMulti)
+
+	if err := isValidSif(&fimg, true); err == nil {
+		t.Fatal("expected error validating multi-arch SIF with no descriptors loaded, got nil")
+	}
+
+	fimg.DescrArr = []Descriptor{hostPartitionDescriptor(t, runtime.GOARCH)}
+
+	if err := isValidSif(&fimg, true); err != nil {
+		t.Fatalf("unexpected error once descriptors are populated: %v", err)
+	}
+}
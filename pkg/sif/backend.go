@@ -0,0 +1,54 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// Copyright (c) 2023, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"fmt"
+	"os"
+)
+
+// fileBackend abstracts the platform- and size-dependent mechanism used to
+// access the bytes of a SIF file backed by an *os.File, so FileImage's
+// readers and descriptor writers don't need to know whether the file is
+// mapped into the address space or accessed with plain pread/pwrite.
+type fileBackend interface {
+	ReadAt(p []byte, off int64) (int, error)
+	WriteAt(p []byte, off int64) (int, error)
+	Size() int64
+	Close() error
+}
+
+// MmapSizeThreshold is the file size, in bytes, above which newFileBackend
+// prefers the pread/pwrite fallback over mapping the file into the address
+// space. This avoids the "file is too big to be mapped" failure on
+// platforms or processes with limited addressable memory. Lower it to force
+// the fallback (for example in tests); raise it on platforms known to
+// handle large mappings well.
+var MmapSizeThreshold int64 = 1 << 34 // 16 GiB
+
+// newFileBackend selects and opens a fileBackend for fp. It prefers the
+// platform's native memory-mapping implementation for files at or under
+// MmapSizeThreshold, and falls back to pread/pwrite via fp itself if the
+// file is larger, or if the mapping attempt fails.
+func newFileBackend(fp *os.File, rdonly bool) (fileBackend, error) {
+	info, err := fp.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("while trying to size SIF file: %s", err)
+	}
+	size := info.Size()
+
+	if size <= MmapSizeThreshold {
+		if b, err := newMmapBackend(fp, size, rdonly); err == nil {
+			return b, nil
+		}
+	}
+
+	return newFileIOBackend(fp, size), nil
+}
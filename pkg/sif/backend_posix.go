@@ -0,0 +1,81 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// Copyright (c) 2023, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+//go:build !windows
+
+package sif
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"syscall"
+)
+
+// mmapBackend is a fileBackend backed by a POSIX mmap of the whole file.
+type mmapBackend struct {
+	data []byte // data[:size], reslice of the page-aligned mapping
+}
+
+// newMmapBackend mmaps the first size bytes of fp.
+func newMmapBackend(fp *os.File, size int64, rdonly bool) (fileBackend, error) {
+	prot := syscall.PROT_READ
+	flags := syscall.MAP_PRIVATE
+
+	mapSize := nextAligned(size, syscall.Getpagesize())
+	if int64(int(mapSize)) < size {
+		return nil, fmt.Errorf("file is too big to be mapped")
+	}
+
+	if !rdonly {
+		prot = syscall.PROT_WRITE
+		flags = syscall.MAP_SHARED
+	}
+
+	data, err := syscall.Mmap(int(fp.Fd()), 0, int(mapSize), prot, flags)
+	if err != nil {
+		return nil, fmt.Errorf("while trying to call mmap on SIF file: %s", err)
+	}
+
+	return &mmapBackend{data: data[:size]}, nil
+}
+
+func (b *mmapBackend) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 || off > int64(len(b.data)) {
+		return 0, io.EOF
+	}
+
+	n := copy(p, b.data[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+
+	return n, nil
+}
+
+func (b *mmapBackend) WriteAt(p []byte, off int64) (int, error) {
+	if off < 0 || off > int64(len(b.data)) {
+		return 0, fmt.Errorf("write offset %d out of range", off)
+	}
+	if off+int64(len(p)) > int64(len(b.data)) {
+		return 0, fmt.Errorf("write of %d bytes at offset %d exceeds mapped size %d", len(p), off, len(b.data))
+	}
+
+	return copy(b.data[off:], p), nil
+}
+
+func (b *mmapBackend) Size() int64 { return int64(len(b.data)) }
+
+func (b *mmapBackend) Close() error {
+	// Munmap requires the slice at its original, page-aligned length.
+	if err := syscall.Munmap(b.data[:cap(b.data)]); err != nil {
+		return fmt.Errorf("while calling unmapping SIF file: %s", err)
+	}
+	return nil
+}
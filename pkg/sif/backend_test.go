@@ -0,0 +1,80 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// Copyright (c) 2023, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestFileBackendWriteAt exercises WriteAt's fixed-size-region contract on
+// both fileBackend implementations newFileBackend can select: the same
+// logical write must succeed or fail the same way regardless of which one a
+// given file size happens to pick.
+func TestFileBackendWriteAt(t *testing.T) {
+	tests := []struct {
+		name              string
+		mmapSizeThreshold int64
+	}{
+		{name: "Mmap", mmapSizeThreshold: MmapSizeThreshold},
+		{name: "FileIO", mmapSizeThreshold: 0},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			old := MmapSizeThreshold
+			MmapSizeThreshold = tt.mmapSizeThreshold
+			defer func() { MmapSizeThreshold = old }()
+
+			path := filepath.Join(t.TempDir(), "backend")
+			if err := os.WriteFile(path, []byte("hello"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			fp, err := os.OpenFile(path, os.O_RDWR, 0o644)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer fp.Close()
+
+			b, err := newFileBackend(fp, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer b.Close()
+
+			if n, err := b.WriteAt([]byte("HELLO"), 0); err != nil || n != 5 {
+				t.Fatalf("got (%d, %v), want (5, nil)", n, err)
+			}
+
+			got := make([]byte, 5)
+			if _, err := b.ReadAt(got, 0); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, []byte("HELLO")) {
+				t.Errorf("got %q, want %q", got, "HELLO")
+			}
+
+			// A write that reaches past the end of the mapped region
+			// (including appending new data at off == Size()) must return
+			// a clean error, not silently copy a truncated prefix (or, for
+			// fileIOBackend, silently grow the file) and report success.
+			if n, err := b.WriteAt([]byte("!"), b.Size()); err == nil {
+				t.Errorf("got (%d, nil), want an error for write past mapped size", n)
+			}
+			if n, err := b.WriteAt([]byte("abcdef"), 2); err == nil {
+				t.Errorf("got (%d, nil), want an error for write extending past mapped size", n)
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// Copyright (c) 2023, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+//go:build windows
+
+package sif
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// mmapBackend is a fileBackend backed by a Windows file mapping, created
+// with CreateFileMapping/MapViewOfFile.
+type mmapBackend struct {
+	handle windows.Handle
+	addr   uintptr
+	data   []byte
+}
+
+// newMmapBackend maps the first size bytes of fp.
+func newMmapBackend(fp *os.File, size int64, rdonly bool) (fileBackend, error) {
+	prot := uint32(windows.PAGE_READONLY)
+	access := uint32(windows.FILE_MAP_READ)
+	if !rdonly {
+		prot = windows.PAGE_READWRITE
+		access = windows.FILE_MAP_WRITE
+	}
+
+	h, err := windows.CreateFileMapping(windows.Handle(fp.Fd()), nil, prot, uint32(size>>32), uint32(size), nil)
+	if err != nil {
+		return nil, fmt.Errorf("while trying to call CreateFileMapping on SIF file: %s", err)
+	}
+
+	addr, err := windows.MapViewOfFile(h, access, 0, 0, uintptr(size))
+	if err != nil {
+		windows.CloseHandle(h)
+		return nil, fmt.Errorf("while trying to call MapViewOfFile on SIF file: %s", err)
+	}
+
+	data := unsafe.Slice((*byte)(unsafe.Pointer(addr)), size)
+
+	return &mmapBackend{handle: h, addr: addr, data: data}, nil
+}
+
+func (b *mmapBackend) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 || off > int64(len(b.data)) {
+		return 0, io.EOF
+	}
+
+	n := copy(p, b.data[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+
+	return n, nil
+}
+
+func (b *mmapBackend) WriteAt(p []byte, off int64) (int, error) {
+	if off < 0 || off > int64(len(b.data)) {
+		return 0, fmt.Errorf("write offset %d out of range", off)
+	}
+	if off+int64(len(p)) > int64(len(b.data)) {
+		return 0, fmt.Errorf("write of %d bytes at offset %d exceeds mapped size %d", len(p), off, len(b.data))
+	}
+
+	return copy(b.data[off:], p), nil
+}
+
+func (b *mmapBackend) Size() int64 { return int64(len(b.data)) }
+
+func (b *mmapBackend) Close() error {
+	if err := windows.UnmapViewOfFile(b.addr); err != nil {
+		return fmt.Errorf("while calling UnmapViewOfFile on SIF file: %s", err)
+	}
+	if err := windows.CloseHandle(b.handle); err != nil {
+		return fmt.Errorf("while closing SIF file mapping handle: %s", err)
+	}
+	return nil
+}
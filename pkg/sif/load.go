@@ -11,31 +11,38 @@ import (
 	"bytes"
 	"encoding/binary"
 	"fmt"
+	"io"
 	"os"
 	"runtime"
-	"syscall"
 )
 
-// Read the global header from the container file
-func readHeader(fimg *FileImage) error {
-	if err := binary.Read(fimg.Reader, binary.LittleEndian, &fimg.Header); err != nil {
+// readHeader reads the global header from sr into fimg. sr is expected to be
+// positioned at the start of the container.
+func readHeader(fimg *FileImage, sr *io.SectionReader) error {
+	if _, err := sr.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("seek() setting to container start: %s", err)
+	}
+
+	if err := binary.Read(sr, binary.LittleEndian, &fimg.Header); err != nil {
 		return fmt.Errorf("reading global header from container file: %s", err)
 	}
 
 	return nil
 }
 
-// Read the used descriptors and populate an in-memory representation of those in node list
-func readDescriptors(fimg *FileImage) error {
+// readDescriptors reads all fimg.Header.Dtotal descriptors from sr, used or
+// not, into fimg.DescrArr. fimg.Header must
+// already be populated by readHeader.
+func readDescriptors(fimg *FileImage, sr *io.SectionReader) error {
 	// start by positioning us to the start of descriptors
-	_, err := fimg.Reader.Seek(fimg.Header.Descroff, 0)
+	_, err := sr.Seek(fimg.Header.Descroff, io.SeekStart)
 	if err != nil {
 		return fmt.Errorf("seek() setting to descriptors start: %s", err)
 	}
 
 	// Initialize descriptor array (slice) and read them all from file
 	fimg.DescrArr = make([]Descriptor, fimg.Header.Dtotal)
-	if err := binary.Read(fimg.Reader, binary.LittleEndian, &fimg.DescrArr); err != nil {
+	if err := binary.Read(sr, binary.LittleEndian, &fimg.DescrArr); err != nil {
 		fimg.DescrArr = nil
 		return fmt.Errorf("reading descriptor array from container file: %s", err)
 	}
@@ -61,55 +68,55 @@ func isValidSif(fimg *FileImage, runnable bool) error {
 		return fmt.Errorf("invalid SIF file: Version %s want %s", fimg.Header.Version, HdrVersion)
 	}
 	if runnable {
-		// Assume amd64 runs i386 code
-		if (string(fimg.Header.Arch[:HdrArchLen-1]) == HdrArchAMD64) && (arch != HdrArch386 && arch != HdrArchAMD64) {
-			return fmt.Errorf("invalid SIF file: Arch %s want %s", fimg.Header.Arch, arch)
-		}
-		if string(fimg.Header.Arch[:HdrArchLen-1]) != arch {
-			return fmt.Errorf("invalid SIF file: Arch %s want %s", fimg.Header.Arch, arch)
+		hdrArch := string(fimg.Header.Arch[:HdrArchLen-1])
+
+		if hdrArch == HdrArchMulti {
+			// A multi-arch "fat" SIF is runnable as long as it carries a
+			// root filesystem partition for the host arch; the global
+			// header arch no longer identifies a single architecture.
+			if _, _, err := fimg.SelectPartition(runtime.GOARCH); err != nil {
+				return fmt.Errorf("invalid SIF file: no partition for host arch %s: %s", arch, err)
+			}
+		} else {
+			// Assume amd64 runs i386 code
+			if (hdrArch == HdrArchAMD64) && (arch != HdrArch386 && arch != HdrArchAMD64) {
+				return fmt.Errorf("invalid SIF file: Arch %s want %s", fimg.Header.Arch, arch)
+			}
+			if hdrArch != arch {
+				return fmt.Errorf("invalid SIF file: Arch %s want %s", fimg.Header.Arch, arch)
+			}
 		}
 	}
 
 	return nil
 }
 
-// mapFile takes a file pointer and returns a slice of bytes representing the file data
+// mapFile opens a fileBackend over fimg.Fp. It prefers mapping the file
+// into the address space, but transparently falls back to plain
+// pread/pwrite for files over MmapSizeThreshold, or when mapping fails.
+//
+// This replaces the previous fimg.Filedata byte slice: every descriptor
+// writer (AddObject, DeleteObject, and SetHeaderArch) must write through
+// fimg.backend, not through Filedata, which this method no longer
+// populates.
 func (fimg *FileImage) mapFile(rdonly bool) error {
-	prot := syscall.PROT_READ
-	flags := syscall.MAP_PRIVATE
-
 	info, err := fimg.Fp.Stat()
 	if err != nil {
-		return fmt.Errorf("while trying to size SIF file to mmap")
+		return fmt.Errorf("while trying to size SIF file: %s", err)
 	}
 	fimg.Filesize = info.Size()
 
-	size := nextAligned(info.Size(), syscall.Getpagesize())
-	if int64(int(size)) < info.Size() {
-		return fmt.Errorf("file is to big to be mapped")
-	}
-
-	if rdonly == false {
-		prot = syscall.PROT_WRITE
-		flags = syscall.MAP_SHARED
-	}
-
-	fimg.Filedata, err = syscall.Mmap(int(fimg.Fp.Fd()), 0, int(size), prot, flags)
+	backend, err := newFileBackend(fimg.Fp, rdonly)
 	if err != nil {
-		return fmt.Errorf("while trying to call mmap on SIF file")
+		return err
 	}
-
-	// create and associate a new bytes.Reader on top of mmap'ed data from file
-	fimg.Reader = bytes.NewReader(fimg.Filedata)
+	fimg.backend = backend
 
 	return nil
 }
 
 func (fimg *FileImage) unmapFile() error {
-	if err := syscall.Munmap(fimg.Filedata); err != nil {
-		return fmt.Errorf("while calling unmapping SIF file")
-	}
-	return nil
+	return fimg.backend.Close()
 }
 
 // LoadContainer is responsible for loading a SIF container file. It takes
@@ -126,23 +133,28 @@ func LoadContainer(filename string, rdonly bool) (fimg FileImage, err error) {
 		}
 	}
 
-	// get a memory map of the SIF file
+	// open a file backend (mmap where possible) over the SIF file
 	if err = fimg.mapFile(rdonly); err != nil {
 		return
 	}
 
+	sr := io.NewSectionReader(fimg.backend, 0, fimg.Filesize)
+	fimg.Reader = sr
+
 	// read global header from SIF file
-	if err = readHeader(&fimg); err != nil {
+	if err = readHeader(&fimg, sr); err != nil {
 		return
 	}
 
-	// validate global header
-	if err = isValidSif(&fimg, true); err != nil {
+	// read descriptor array from SIF file: isValidSif's multi-arch check
+	// below selects a partition by looking at fimg.DescrArr, so this must
+	// run before validation.
+	if err = readDescriptors(&fimg, sr); err != nil {
 		return
 	}
 
-	// read descriptor array from SIF file
-	if err = readDescriptors(&fimg); err != nil {
+	// validate global header
+	if err = isValidSif(&fimg, true); err != nil {
 		return
 	}
 
@@ -159,23 +171,28 @@ func LoadContainerFp(fp *os.File, rdonly bool) (fimg FileImage, err error) {
 
 	fimg.Fp = fp
 
-	// get a memory map of the SIF file
+	// open a file backend (mmap where possible) over the SIF file
 	if err = fimg.mapFile(rdonly); err != nil {
 		return
 	}
 
+	sr := io.NewSectionReader(fimg.backend, 0, fimg.Filesize)
+	fimg.Reader = sr
+
 	// read global header from SIF file
-	if err = readHeader(&fimg); err != nil {
+	if err = readHeader(&fimg, sr); err != nil {
 		return
 	}
 
-	// validate global header
-	if err = isValidSif(&fimg, true); err != nil {
+	// read descriptor array from SIF file: isValidSif's multi-arch check
+	// below selects a partition by looking at fimg.DescrArr, so this must
+	// run before validation.
+	if err = readDescriptors(&fimg, sr); err != nil {
 		return
 	}
 
-	// read descriptor array from SIF file
-	if err = readDescriptors(&fimg); err != nil {
+	// validate global header
+	if err = isValidSif(&fimg, true); err != nil {
 		return
 	}
 
@@ -188,8 +205,10 @@ func LoadContainerFp(fp *os.File, rdonly bool) (fimg FileImage, err error) {
 func LoadContainerReader(b *bytes.Reader) (fimg FileImage, err error) {
 	fimg.Reader = b
 
+	sr := io.NewSectionReader(b, 0, b.Size())
+
 	// read global header from SIF file
-	if err = readHeader(&fimg); err != nil {
+	if err = readHeader(&fimg, sr); err != nil {
 		return
 	}
 
@@ -200,7 +219,53 @@ func LoadContainerReader(b *bytes.Reader) (fimg FileImage, err error) {
 
 	// in the case where the reader buffer doesn't include descriptor data, we
 	// don't return an error and DescrArr will be set to nil
-	readDescriptors(&fimg)
+	readDescriptors(&fimg, sr)
+
+	return fimg, nil
+}
+
+// LoadContainerReaderAt is responsible for loading a SIF container from an
+// io.ReaderAt of the given size, without requiring the source to be
+// mmap'able or fully buffered. This is intended for backends that cannot
+// hand out a raw file descriptor or a single contiguous buffer, such as HTTP
+// range requests against a registry blob, object-storage-backed images, or
+// FUSE overlays, as well as for platforms (Windows) where mmap is not always
+// available.
+//
+// The global header and descriptor table are read up front via ReadAt;
+// partition data is fetched lazily on demand as callers read from
+// fimg.Reader, so the whole file is never buffered in memory.
+//
+// Only read-only access is currently supported: the returned FileImage has
+// no fileBackend wired up to write through r, so rdonly must be true. This
+// will be lifted once a writer-backed fileBackend lands for this entry
+// point; until then, callers that need to mutate the container should use
+// LoadContainer or LoadContainerFp instead.
+func LoadContainerReaderAt(r io.ReaderAt, size int64, rdonly bool) (fimg FileImage, err error) {
+	if !rdonly {
+		return fimg, fmt.Errorf("read-write access is not yet supported by LoadContainerReaderAt")
+	}
+
+	sr := io.NewSectionReader(r, 0, size)
+	fimg.Reader = sr
+	fimg.Filesize = size
+
+	// read global header from SIF file
+	if err = readHeader(&fimg, sr); err != nil {
+		return
+	}
+
+	// read descriptor array from SIF file: isValidSif's multi-arch check
+	// below selects a partition by looking at fimg.DescrArr, so this must
+	// run before validation.
+	if err = readDescriptors(&fimg, sr); err != nil {
+		return
+	}
+
+	// validate global header
+	if err = isValidSif(&fimg, true); err != nil {
+		return
+	}
 
 	return fimg, nil
 }
@@ -0,0 +1,109 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// Copyright (c) 2023, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"bytes"
+	"encoding/binary"
+	"runtime"
+	"testing"
+)
+
+// trackingReaderAt wraps an io.ReaderAt and records the byte range of every
+// ReadAt call it serves, so a test can assert which regions of the source
+// were actually touched.
+type trackingReaderAt struct {
+	r     *bytes.Reader
+	calls [][2]int64 // [off, off+len) per call
+}
+
+func (t *trackingReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	t.calls = append(t.calls, [2]int64{off, off + int64(len(p))})
+	return t.r.ReadAt(p, off)
+}
+
+// buildMinimalSIF encodes a single-descriptor SIF image followed by
+// dataRegion, and returns the full image bytes along with the byte offset
+// dataRegion starts at. The descriptor's Fileoff and Filelen are left zero.
+func buildMinimalSIF(t *testing.T, dataRegion []byte) ([]byte, int64) {
+	t.Helper()
+
+	var h Header
+	headerSize := binary.Size(h)
+	if headerSize <= 0 {
+		t.Fatalf("could not determine fixed Header size: %d", headerSize)
+	}
+
+	copy(h.Magic[:], HdrMagic)
+	copy(h.Version[:], HdrVersion)
+	copy(h.Arch[:], GetSIFArch(runtime.GOARCH))
+	h.Descroff = int64(headerSize)
+	h.Dtotal = 1
+
+	var d Descriptor
+	d.Used = true
+	d.Datatype = DataPartition
+
+	buf := bytes.Buffer{}
+	if err := binary.Write(&buf, binary.LittleEndian, h); err != nil {
+		t.Fatalf("encoding header: %v", err)
+	}
+	if err := binary.Write(&buf, binary.LittleEndian, []Descriptor{d}); err != nil {
+		t.Fatalf("encoding descriptor array: %v", err)
+	}
+
+	dataOff := int64(buf.Len())
+	buf.Write(dataRegion)
+
+	return buf.Bytes(), dataOff
+}
+
+func TestLoadContainerReaderAtReadOnlyEnforced(t *testing.T) {
+	data, _ := buildMinimalSIF(t, []byte("partition-data"))
+	r := bytes.NewReader(data)
+
+	if _, err := LoadContainerReaderAt(r, int64(len(data)), false); err == nil {
+		t.Fatal("expected an error requesting read-write access, got nil")
+	}
+}
+
+func TestLoadContainerReaderAtLazyRead(t *testing.T) {
+	partitionData := []byte("partition-data-not-read-at-load-time")
+	data, dataOff := buildMinimalSIF(t, partitionData)
+
+	tr := &trackingReaderAt{r: bytes.NewReader(data)}
+
+	fimg, err := LoadContainerReaderAt(tr, int64(len(data)), true)
+	if err != nil {
+		t.Fatalf("LoadContainerReaderAt: %v", err)
+	}
+
+	if got, want := len(fimg.DescrArr), 1; got != want {
+		t.Fatalf("got %d descriptors, want %d", got, want)
+	}
+
+	// Loading must not have pulled in the partition bytes up front: every
+	// ReadAt call so far should fall entirely before dataOff.
+	for _, c := range tr.calls {
+		if c[1] > dataOff {
+			t.Errorf("ReadAt range [%d,%d) reached into partition data starting at %d during load", c[0], c[1], dataOff)
+		}
+	}
+
+	// The partition data is still reachable, fetched lazily through
+	// fimg.Reader on demand.
+	got := make([]byte, len(partitionData))
+	if _, err := fimg.Reader.ReadAt(got, dataOff); err != nil {
+		t.Fatalf("reading partition data: %v", err)
+	}
+	if !bytes.Equal(got, partitionData) {
+		t.Errorf("got partition data %q, want %q", got, partitionData)
+	}
+}
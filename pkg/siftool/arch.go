@@ -0,0 +1,165 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// Copyright (c) 2023, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package siftool
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/spf13/cobra"
+
+	"github.com/sylabs/sif/pkg/sif"
+)
+
+// getAddArch, getListArch and getDelArch below are, like getDump and the
+// rest of this package's get* methods, registered as subcommands of the
+// root siftool command by its constructor; they are not runnable on their
+// own.
+
+// getAddArch returns a command that adds a root filesystem partition for
+// arch to a SIF image, turning it into a multi-architecture "fat" SIF.
+func (c *command) getAddArch() *cobra.Command {
+	var fstype string
+
+	cmd := &cobra.Command{
+		Use:   "add-arch <arch> <path> <partition-file>",
+		Short: "Add an architecture's partition to a SIF image",
+		Args:  cobra.ExactArgs(3),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			arch, path, partPath := args[0], args[1], args[2]
+
+			var fs sif.Fstype
+			switch fstype {
+			case "squashfs":
+				fs = sif.FsSquash
+			case "ext3":
+				fs = sif.FsExt3
+			default:
+				return fmt.Errorf("unsupported filesystem type %q", fstype)
+			}
+
+			if sif.GetSIFArch(arch) == sif.HdrArchUnknown {
+				return fmt.Errorf("GOARCH %v not supported", arch)
+			}
+
+			fp, err := os.Open(partPath)
+			if err != nil {
+				return fmt.Errorf("opening %s: %w", partPath, err)
+			}
+			defer fp.Close()
+
+			fimg, err := sif.LoadContainer(path, false)
+			if err != nil {
+				return fmt.Errorf("loading %s: %w", path, err)
+			}
+			defer fimg.UnloadContainer() //nolint:errcheck
+
+			if _, _, err := fimg.SelectPartition(arch); err == nil {
+				return fmt.Errorf("%s already has a partition for arch %s", path, arch)
+			}
+
+			if err := fimg.AddPartition(fp, arch, fs, sif.PartSystem); err != nil {
+				return fmt.Errorf("adding %s partition to %s: %w", arch, path, err)
+			}
+
+			if arches, err := fimg.ArchPartitions(); err == nil && len(arches) > 1 {
+				if err := fimg.SetHeaderArch(sif.HdrArchMulti); err != nil {
+					return fmt.Errorf("marking %s as multi-arch: %w", path, err)
+				}
+			}
+
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&fstype, "fstype", "squashfs", "partition filesystem type (squashfs, ext3)")
+
+	return cmd
+}
+
+// getListArch returns a command that lists the architectures a
+// multi-architecture "fat" SIF carries a root filesystem partition for.
+func (c *command) getListArch() *cobra.Command {
+	return &cobra.Command{
+		Use:   "list-arch <path>",
+		Short: "List architectures present in a SIF image",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			fimg, err := sif.LoadContainer(args[0], true)
+			if err != nil {
+				return fmt.Errorf("loading %s: %w", args[0], err)
+			}
+			defer fimg.UnloadContainer() //nolint:errcheck
+
+			arches, err := fimg.ArchPartitions()
+			if err != nil {
+				return fmt.Errorf("listing partitions in %s: %w", args[0], err)
+			}
+
+			names := make([]string, 0, len(arches))
+			for arch := range arches {
+				names = append(names, arch)
+			}
+			sort.Strings(names)
+
+			for _, arch := range names {
+				fmt.Fprintf(cmd.OutOrStdout(), "%s\t%d\n", arch, arches[arch])
+			}
+
+			return nil
+		},
+	}
+}
+
+// getDelArch returns a command that removes the root filesystem partition
+// for a given architecture from a multi-architecture "fat" SIF.
+func (c *command) getDelArch() *cobra.Command {
+	return &cobra.Command{
+		Use:   "del-arch <arch> <path>",
+		Short: "Remove an architecture's partition from a SIF image",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			arch, path := args[0], args[1]
+
+			fimg, err := sif.LoadContainer(path, false)
+			if err != nil {
+				return fmt.Errorf("loading %s: %w", path, err)
+			}
+			defer fimg.UnloadContainer() //nolint:errcheck
+
+			descr, _, err := fimg.SelectPartition(arch)
+			if err != nil {
+				return fmt.Errorf("locating %s partition in %s: %w", arch, path, err)
+			}
+
+			if err := fimg.DeleteObject(descr.ID, 0); err != nil {
+				return fmt.Errorf("removing %s partition from %s: %w", arch, path, err)
+			}
+
+			// Demote the header off the HdrArchMulti sentinel once only
+			// one architecture remains, so a no-longer-fat SIF doesn't
+			// keep claiming to be one.
+			arches, err := fimg.ArchPartitions()
+			if err != nil {
+				return fmt.Errorf("listing partitions in %s: %w", path, err)
+			}
+			if len(arches) == 1 {
+				for remaining := range arches {
+					if err := fimg.SetHeaderArch(remaining); err != nil {
+						return fmt.Errorf("demoting %s from multi-arch: %w", path, err)
+					}
+				}
+			}
+
+			return nil
+		},
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// Copyright (c) 2023, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package siftool
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// copyFile copies the fixture at src to a new, writable file under t.TempDir(),
+// so mutating commands (add-arch, del-arch) don't touch the corpus fixture.
+func copyFile(t *testing.T, src string) string {
+	t.Helper()
+
+	in, err := os.Open(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+
+	dst := filepath.Join(t.TempDir(), filepath.Base(src))
+	out, err := os.Create(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+
+	if _, err := io.Copy(out, in); err != nil {
+		t.Fatal(err)
+	}
+
+	return dst
+}
+
+func Test_command_getAddArch(t *testing.T) {
+	path := copyFile(t, filepath.Join(corpus, "one-group-signed.sif"))
+	partPath := filepath.Join(corpus, "one-group-signed.sif")
+
+	c := &command{}
+
+	cmd := c.getAddArch()
+
+	runCommand(t, cmd, []string{"arm64", path, partPath}, nil)
+}
+
+func Test_command_getListArch(t *testing.T) {
+	path := filepath.Join(corpus, "two-arch.sif")
+
+	c := &command{}
+
+	cmd := c.getListArch()
+
+	runCommand(t, cmd, []string{path}, nil)
+}
+
+func Test_command_getDelArch(t *testing.T) {
+	path := copyFile(t, filepath.Join(corpus, "two-arch.sif"))
+
+	c := &command{}
+
+	cmd := c.getDelArch()
+
+	runCommand(t, cmd, []string{"arm64", path}, nil)
+}